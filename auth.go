@@ -0,0 +1,138 @@
+package k8sresolver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// authMode selects how NewFromFlags builds the tokenauth.Source used to authenticate against the
+// Kube API server.
+type authMode string
+
+const (
+	// authModeAuto tries, in order, a kubeconfig user, an in-cluster service account token, then a
+	// static token file.
+	authModeAuto       authMode = "auto"
+	authModeInCluster  authMode = "inCluster"
+	authModeToken      authMode = "token"
+	authModeKubeConfig authMode = "kubeconfig"
+	authModeExec       authMode = "exec"
+)
+
+// parseAuthMode validates a --k8sresolver_auth_mode flag value.
+func parseAuthMode(raw string) (authMode, error) {
+	switch authMode(raw) {
+	case authModeAuto, authModeInCluster, authModeToken, authModeKubeConfig, authModeExec:
+		return authMode(raw), nil
+	default:
+		return "", errors.Errorf(
+			"k8sresolver: unknown k8sresolver_auth_mode value %q, expected one of: auto, inCluster, token, kubeconfig, exec", raw)
+	}
+}
+
+// inClusterTokenSource re-reads a projected service account token file from disk on every call past
+// minRefresh, since kubelet rotates projected tokens well before a long-running pod's lifetime ends.
+type inClusterTokenSource struct {
+	name       string
+	path       string
+	minRefresh time.Duration
+
+	mu     sync.Mutex
+	token  string
+	readAt time.Time
+}
+
+func newInClusterTokenSource(name, path string) *inClusterTokenSource {
+	return &inClusterTokenSource{name: name, path: path, minRefresh: 30 * time.Second}
+}
+
+// OAuthToken returns the current service account token, re-reading it from disk if the last read is
+// older than minRefresh.
+func (s *inClusterTokenSource) OAuthToken(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != "" && time.Since(s.readAt) < s.minRefresh {
+		return s.token, nil
+	}
+
+	raw, err := os.ReadFile(s.path)
+	if err != nil {
+		return "", errors.Wrapf(err, "k8sresolver: failed to re-read in-cluster token from %s", s.path)
+	}
+	s.token = strings.TrimSpace(string(raw))
+	s.readAt = time.Now()
+	return s.token, nil
+}
+
+// execCredential and execCredentialStatus mirror the subset of the client.authentication.k8s.io/v1
+// ExecCredential contract we need: https://kubernetes.io/docs/reference/access-authn-authz/authentication/#client-go-credential-plugins
+type execCredential struct {
+	APIVersion string                `json:"apiVersion"`
+	Kind       string                `json:"kind"`
+	Status     *execCredentialStatus `json:"status,omitempty"`
+}
+
+type execCredentialStatus struct {
+	Token               string     `json:"token"`
+	ExpirationTimestamp *time.Time `json:"expirationTimestamp,omitempty"`
+}
+
+// execCredentialSource authenticates by shelling out to an external credential plugin (e.g.
+// aws-iam-authenticator, gke-gcloud-auth-plugin, an OIDC refresher) and caches the returned token
+// until its expirationTimestamp, re-invoking the plugin only once that passes.
+type execCredentialSource struct {
+	name    string
+	command string
+	args    []string
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+func newExecCredentialSource(name, command string, args []string) *execCredentialSource {
+	return &execCredentialSource{name: name, command: command, args: args}
+}
+
+// OAuthToken runs the configured credential plugin and returns its token, reusing the cached token
+// until expiresAt is reached.
+func (s *execCredentialSource) OAuthToken(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != "" && (s.expiresAt.IsZero() || time.Now().Before(s.expiresAt)) {
+		return s.token, nil
+	}
+
+	cmd := exec.CommandContext(ctx, s.command, s.args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", errors.Wrapf(err, "k8sresolver: exec credential plugin %s failed: %s", s.command, stderr.String())
+	}
+
+	var cred execCredential
+	if err := json.Unmarshal(stdout.Bytes(), &cred); err != nil {
+		return "", errors.Wrapf(err, "k8sresolver: failed to decode ExecCredential from plugin %s", s.command)
+	}
+	if cred.Status == nil || cred.Status.Token == "" {
+		return "", errors.Errorf("k8sresolver: exec credential plugin %s returned no token", s.command)
+	}
+
+	s.token = cred.Status.Token
+	s.expiresAt = time.Time{}
+	if cred.Status.ExpirationTimestamp != nil {
+		s.expiresAt = *cred.Status.ExpirationTimestamp
+	}
+	return s.token, nil
+}
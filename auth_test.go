@@ -0,0 +1,136 @@
+package k8sresolver
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAuthMode(t *testing.T) {
+	for _, tc := range []struct {
+		raw     string
+		want    authMode
+		wantErr bool
+	}{
+		{raw: "auto", want: authModeAuto},
+		{raw: "inCluster", want: authModeInCluster},
+		{raw: "token", want: authModeToken},
+		{raw: "kubeconfig", want: authModeKubeConfig},
+		{raw: "exec", want: authModeExec},
+		{raw: "bogus", wantErr: true},
+		{raw: "", wantErr: true},
+	} {
+		t.Run(tc.raw, func(t *testing.T) {
+			got, err := parseAuthMode(tc.raw)
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestInClusterTokenSource_OAuthToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(path, []byte("token-v1\n"), 0600))
+
+	src := &inClusterTokenSource{name: "kube_api", path: path, minRefresh: 20 * time.Millisecond}
+
+	token, err := src.OAuthToken(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "token-v1", token)
+
+	// Within minRefresh, the cached token is returned even though the file on disk changed.
+	require.NoError(t, os.WriteFile(path, []byte("token-v2"), 0600))
+	token, err = src.OAuthToken(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "token-v1", token, "expected the cached token within minRefresh")
+
+	// Past minRefresh, the token file is re-read.
+	time.Sleep(30 * time.Millisecond)
+	token, err = src.OAuthToken(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "token-v2", token, "expected a fresh read once minRefresh elapsed")
+}
+
+func TestInClusterTokenSource_OAuthToken_MissingFile(t *testing.T) {
+	src := newInClusterTokenSource("kube_api", filepath.Join(t.TempDir(), "does-not-exist"))
+
+	_, err := src.OAuthToken(context.Background())
+	require.Error(t, err)
+}
+
+func requireSh(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available in PATH")
+	}
+}
+
+func TestExecCredentialSource_OAuthToken(t *testing.T) {
+	requireSh(t)
+
+	expiresAt := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	script := fmt.Sprintf(`echo '{"apiVersion":"client.authentication.k8s.io/v1","kind":"ExecCredential","status":{"token":"exec-token","expirationTimestamp":"%s"}}'`, expiresAt)
+
+	src := newExecCredentialSource("kube_api", "sh", []string{"-c", script})
+
+	token, err := src.OAuthToken(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "exec-token", token)
+	require.False(t, src.expiresAt.IsZero())
+
+	// The cached token must be reused without re-invoking the plugin while still valid; point the
+	// plugin at a command that would fail if OAuthToken shelled out again.
+	src.command = "sh"
+	src.args = []string{"-c", "exit 1"}
+	token, err = src.OAuthToken(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "exec-token", token)
+}
+
+func TestExecCredentialSource_OAuthToken_NoExpiration(t *testing.T) {
+	requireSh(t)
+
+	src := newExecCredentialSource("kube_api", "sh",
+		[]string{"-c", `echo '{"status":{"token":"first"}}'`})
+
+	first, err := src.OAuthToken(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "first", first)
+
+	// A plugin response with no expirationTimestamp must be cached indefinitely, not re-run on
+	// every call.
+	src.args = []string{"-c", `echo '{"status":{"token":"second"}}'`}
+	second, err := src.OAuthToken(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "first", second)
+}
+
+func TestExecCredentialSource_OAuthToken_PluginFailure(t *testing.T) {
+	requireSh(t)
+
+	src := newExecCredentialSource("kube_api", "sh", []string{"-c", "echo boom 1>&2; exit 1"})
+
+	_, err := src.OAuthToken(context.Background())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "boom")
+}
+
+func TestExecCredentialSource_OAuthToken_NoToken(t *testing.T) {
+	requireSh(t)
+
+	src := newExecCredentialSource("kube_api", "sh",
+		[]string{"-c", `echo '{"apiVersion":"client.authentication.k8s.io/v1","kind":"ExecCredential","status":{}}'`})
+
+	_, err := src.OAuthToken(context.Background())
+	require.Error(t, err)
+}
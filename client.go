@@ -0,0 +1,147 @@
+package k8sresolver
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/Bplotka/go-tokenauth"
+	"github.com/pkg/errors"
+)
+
+// endpointClient abstracts the Kube API server operations streamWatcher needs: opening a change
+// stream, a single unary read, and a full LIST for resync.
+type endpointClient interface {
+	// StartChangeStream opens a watch stream for target starting at resourceVersion, optionally
+	// requesting the apiserver to interleave BOOKMARK events.
+	StartChangeStream(ctx context.Context, target targetEntry, resourceVersion int, allowBookmarks bool) (io.ReadCloser, error)
+	// StartSingleUnary performs a single, non-streaming request for target.
+	StartSingleUnary(ctx context.Context, target targetEntry, resourceVersion int) (io.ReadCloser, error)
+	// ListEndpoints does a full LIST of target's Endpoints, returning the merged object and the
+	// resourceVersion the list was served at.
+	ListEndpoints(ctx context.Context, target targetEntry) (endpoints, string, error)
+}
+
+// endpointsList is the subset of a Kubernetes EndpointsList response ListEndpoints needs: the list's
+// own resourceVersion plus, since a namespaced name fieldSelector scopes the result to at most one
+// item, that single Endpoints object.
+type endpointsList struct {
+	Metadata metadata    `json:"metadata"`
+	Items    []endpoints `json:"items"`
+}
+
+// httpEndpointClient is the default endpointClient: it talks to the Kube API server's Endpoints
+// sub-resource over HTTP(S), upgrading the watch call to the websocket transport when configured.
+type httpEndpointClient struct {
+	baseURL    string
+	source     tokenauth.Source
+	httpClient *http.Client
+	transport  watchTransport
+}
+
+func newHTTPEndpointClient(baseURL string, source tokenauth.Source, tlsConfig *tls.Config, transport watchTransport) *httpEndpointClient {
+	return &httpEndpointClient{
+		baseURL:    baseURL,
+		source:     source,
+		httpClient: &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}},
+		transport:  transport,
+	}
+}
+
+func (c *httpEndpointClient) endpointsURL(target targetEntry, resourceVersion int, watch, allowBookmarks bool) string {
+	url := fmt.Sprintf("%s/api/v1/namespaces/%s/endpoints?fieldSelector=metadata.name=%s&resourceVersion=%d",
+		c.baseURL, target.namespace, target.service, resourceVersion)
+	if watch {
+		url += "&watch=1"
+		if allowBookmarks {
+			url += "&allowWatchBookmarks=true"
+		}
+	}
+	return url
+}
+
+func (c *httpEndpointClient) authHeader(ctx context.Context) (http.Header, error) {
+	token, err := c.source.OAuthToken(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "k8sresolver: failed to get auth token")
+	}
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+token)
+	return header, nil
+}
+
+func (c *httpEndpointClient) do(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "k8sresolver: failed to build request to %s", url)
+	}
+	header, err := c.authHeader(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = header
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "k8sresolver: request to %s failed", url)
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, &apiserverError{StatusCode: resp.StatusCode, Body: string(body), Err: errors.Errorf("unexpected status from %s", url)}
+	}
+	return resp, nil
+}
+
+// StartChangeStream opens a watch stream for target. When the client is configured for the
+// websocket transport it dials the Kubernetes watch subprotocol directly; otherwise it falls back to
+// a chunked HTTP GET, same as before the websocket transport existed.
+func (c *httpEndpointClient) StartChangeStream(ctx context.Context, target targetEntry, resourceVersion int, allowBookmarks bool) (io.ReadCloser, error) {
+	watchURL := c.endpointsURL(target, resourceVersion, true, allowBookmarks)
+
+	if c.transport == websocketWatchTransport {
+		header, err := c.authHeader(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return dialWatchWebsocket(ctx, watchURL, header)
+	}
+
+	resp, err := c.do(ctx, watchURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "k8sresolver: failed to start watch stream")
+	}
+	return resp.Body, nil
+}
+
+// StartSingleUnary performs a single, non-streaming GET against target's Endpoints.
+func (c *httpEndpointClient) StartSingleUnary(ctx context.Context, target targetEntry, resourceVersion int) (io.ReadCloser, error) {
+	resp, err := c.do(ctx, c.endpointsURL(target, resourceVersion, false, false))
+	if err != nil {
+		return nil, errors.Wrap(err, "k8sresolver: failed to do unary request")
+	}
+	return resp.Body, nil
+}
+
+// ListEndpoints does a full LIST of target's Endpoints and returns the single matching item along
+// with the list's resourceVersion.
+func (c *httpEndpointClient) ListEndpoints(ctx context.Context, target targetEntry) (endpoints, string, error) {
+	resp, err := c.do(ctx, c.endpointsURL(target, 0, false, false))
+	if err != nil {
+		return endpoints{}, "", errors.Wrap(err, "k8sresolver: failed to LIST endpoints")
+	}
+	defer resp.Body.Close()
+
+	var list endpointsList
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return endpoints{}, "", errors.Wrap(err, "k8sresolver: failed to decode EndpointsList")
+	}
+	if len(list.Items) == 0 {
+		return endpoints{}, list.Metadata.ResourceVersion, nil
+	}
+	return list.Items[0], list.Metadata.ResourceVersion, nil
+}
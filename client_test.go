@@ -0,0 +1,196 @@
+package k8sresolver
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeTokenSource struct {
+	token string
+	err   error
+}
+
+func (s *fakeTokenSource) OAuthToken(ctx context.Context) (string, error) {
+	return s.token, s.err
+}
+
+func TestHTTPEndpointClient_EndpointsURL(t *testing.T) {
+	c := newHTTPEndpointClient("https://k8s.local", &fakeTokenSource{}, nil, httpWatchTransport)
+	target := targetEntry{service: "service1", namespace: "namespace1"}
+
+	for _, tc := range []struct {
+		name           string
+		resourceVer    int
+		watch          bool
+		allowBookmarks bool
+		want           string
+	}{
+		{
+			name:        "list",
+			resourceVer: 0,
+			watch:       false,
+			want:        "https://k8s.local/api/v1/namespaces/namespace1/endpoints?fieldSelector=metadata.name=service1&resourceVersion=0",
+		},
+		{
+			name:        "watch without bookmarks",
+			resourceVer: 42,
+			watch:       true,
+			want:        "https://k8s.local/api/v1/namespaces/namespace1/endpoints?fieldSelector=metadata.name=service1&resourceVersion=42&watch=1",
+		},
+		{
+			name:           "watch with bookmarks",
+			resourceVer:    42,
+			watch:          true,
+			allowBookmarks: true,
+			want:           "https://k8s.local/api/v1/namespaces/namespace1/endpoints?fieldSelector=metadata.name=service1&resourceVersion=42&watch=1&allowWatchBookmarks=true",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := c.endpointsURL(target, tc.resourceVer, tc.watch, tc.allowBookmarks)
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestHTTPEndpointClient_AuthHeader(t *testing.T) {
+	c := newHTTPEndpointClient("https://k8s.local", &fakeTokenSource{token: "a-token"}, nil, httpWatchTransport)
+
+	header, err := c.authHeader(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "Bearer a-token", header.Get("Authorization"))
+}
+
+func TestHTTPEndpointClient_AuthHeader_SourceError(t *testing.T) {
+	c := newHTTPEndpointClient("https://k8s.local", &fakeTokenSource{err: errors.New("no token")}, nil, httpWatchTransport)
+
+	_, err := c.authHeader(context.Background())
+	require.Error(t, err)
+}
+
+func TestHTTPEndpointClient_StartChangeStream_HTTPTransport(t *testing.T) {
+	var gotHeader http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header.Clone()
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"type":"ADDED"}` + "\n"))
+	}))
+	defer server.Close()
+
+	c := newHTTPEndpointClient(server.URL, &fakeTokenSource{token: "a-token"}, nil, httpWatchTransport)
+	target := targetEntry{service: "service1", namespace: "namespace1"}
+
+	stream, err := c.StartChangeStream(context.Background(), target, 0, true)
+	require.NoError(t, err)
+	defer stream.Close()
+
+	require.Equal(t, "Bearer a-token", gotHeader.Get("Authorization"))
+
+	body, err := io.ReadAll(stream)
+	require.NoError(t, err)
+	require.Equal(t, `{"type":"ADDED"}`+"\n", string(body))
+}
+
+func TestHTTPEndpointClient_StartChangeStream_WebsocketTransport(t *testing.T) {
+	upgrader := websocket.Upgrader{Subprotocols: []string{websocketChannelSubProtocol}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		require.NoError(t, err)
+		defer conn.Close()
+
+		payload := base64.StdEncoding.EncodeToString([]byte(`{"type":"ADDED"}`))
+		require.NoError(t, conn.WriteMessage(websocket.BinaryMessage, append([]byte{0}, payload...)))
+	}))
+	defer server.Close()
+
+	c := newHTTPEndpointClient(server.URL, &fakeTokenSource{token: "a-token"}, nil, websocketWatchTransport)
+	target := targetEntry{service: "service1", namespace: "namespace1"}
+
+	stream, err := c.StartChangeStream(context.Background(), target, 0, true)
+	require.NoError(t, err)
+	defer stream.Close()
+
+	buf := make([]byte, 64)
+	n, err := stream.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, `{"type":"ADDED"}`+"\n", string(buf[:n]))
+}
+
+func TestHTTPEndpointClient_Do_NonOKStatusSurfacesAPIServerError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte("upstream connect error"))
+	}))
+	defer server.Close()
+
+	c := newHTTPEndpointClient(server.URL, &fakeTokenSource{token: "a-token"}, nil, httpWatchTransport)
+	target := targetEntry{service: "service1", namespace: "namespace1"}
+
+	_, err := c.StartSingleUnary(context.Background(), target, 0)
+	require.Error(t, err)
+
+	apiErr, ok := errors.Cause(err).(*apiserverError)
+	require.True(t, ok, "expected the error to wrap an *apiserverError")
+	require.Equal(t, http.StatusServiceUnavailable, apiErr.StatusCode)
+	require.Equal(t, "upstream connect error", apiErr.Body)
+}
+
+func TestHTTPEndpointClient_ListEndpoints(t *testing.T) {
+	wantEndpoints := endpoints{
+		Metadata: metadata{ResourceVersion: "200"},
+		Subsets: []subset{
+			{
+				Ports:     []port{{Port: 8080, Name: "noName"}},
+				Addresses: []address{{IP: "5.6.7.8"}},
+			},
+		},
+	}
+	list := endpointsList{
+		Metadata: metadata{ResourceVersion: "200"},
+		Items:    []endpoints{wantEndpoints},
+	}
+	b, err := json.Marshal(list)
+	require.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(b)
+	}))
+	defer server.Close()
+
+	c := newHTTPEndpointClient(server.URL, &fakeTokenSource{token: "a-token"}, nil, httpWatchTransport)
+	target := targetEntry{service: "service1", namespace: "namespace1"}
+
+	eps, rv, err := c.ListEndpoints(context.Background(), target)
+	require.NoError(t, err)
+	require.Equal(t, "200", rv)
+	require.Equal(t, wantEndpoints, eps)
+}
+
+func TestHTTPEndpointClient_ListEndpoints_NoItems(t *testing.T) {
+	list := endpointsList{Metadata: metadata{ResourceVersion: "200"}}
+	b, err := json.Marshal(list)
+	require.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(b)
+	}))
+	defer server.Close()
+
+	c := newHTTPEndpointClient(server.URL, &fakeTokenSource{token: "a-token"}, nil, httpWatchTransport)
+	target := targetEntry{service: "service1", namespace: "namespace1"}
+
+	eps, rv, err := c.ListEndpoints(context.Background(), target)
+	require.NoError(t, err)
+	require.Equal(t, "200", rv)
+	require.Equal(t, endpoints{}, eps)
+}
@@ -0,0 +1,71 @@
+package k8sresolver
+
+import (
+	"fmt"
+
+	grpcresolver "google.golang.org/grpc/resolver"
+)
+
+// addressKey uniquely identifies a single Endpoints address+port tuple, the unit diffed between
+// successive watch events for a target.
+type addressKey struct {
+	ip   string
+	port int32
+}
+
+// endpointsDiffer tracks the last-seen address set for a single target and turns each incoming
+// endpoints object into an Added/Removed diff against it, so downstream gRPC balancer code does not
+// have to recompute the full address set itself on every MODIFIED event.
+type endpointsDiffer struct {
+	last map[addressKey]grpcresolver.Address
+}
+
+func newEndpointsDiffer() *endpointsDiffer {
+	return &endpointsDiffer{last: map[addressKey]grpcresolver.Address{}}
+}
+
+// diff returns the addresses added and removed between the differ's last known state and eps, and
+// replaces the tracked state with eps's address set.
+func (d *endpointsDiffer) diff(eps endpoints) (added, removed []grpcresolver.Address) {
+	next := addressesOf(eps)
+
+	for key, addr := range next {
+		if _, ok := d.last[key]; !ok {
+			added = append(added, addr)
+		}
+	}
+	for key, addr := range d.last {
+		if _, ok := next[key]; !ok {
+			removed = append(removed, addr)
+		}
+	}
+
+	d.last = next
+	return added, removed
+}
+
+// diffRemoveAll returns every currently tracked address as removed and clears the tracked state. It is
+// used for DELETED events, where the entire target has gone away.
+func (d *endpointsDiffer) diffRemoveAll() (removed []grpcresolver.Address) {
+	for _, addr := range d.last {
+		removed = append(removed, addr)
+	}
+	d.last = map[addressKey]grpcresolver.Address{}
+	return removed
+}
+
+// addressesOf flattens an Endpoints object's subsets into a map keyed by IP+port, the same shape
+// endpointsDiffer compares across events.
+func addressesOf(eps endpoints) map[addressKey]grpcresolver.Address {
+	out := map[addressKey]grpcresolver.Address{}
+	for _, subset := range eps.Subsets {
+		for _, p := range subset.Ports {
+			for _, a := range subset.Addresses {
+				out[addressKey{ip: a.IP, port: p.Port}] = grpcresolver.Address{
+					Addr: fmt.Sprintf("%s:%d", a.IP, p.Port),
+				}
+			}
+		}
+	}
+	return out
+}
@@ -42,6 +42,19 @@ var (
 			"This auth method has priority 1.")
 	fKubeConfigAuthPath = FlagSet.String("k8sresolver_kubeconfig_path", "", "Kube config path. "+
 		"Only used when k8sresolver_kubeconfig_user is specified. If empty it will try default path.")
+
+	fAuthMode = FlagSet.String("k8sresolver_auth_mode", string(authModeAuto),
+		"Auth method to use against the Kube API server. One of: auto, inCluster, token, kubeconfig, exec. "+
+			"'auto' tries kubeconfig, then inCluster, then a static token file.")
+	fExecCommand = FlagSet.String("k8sresolver_exec_command", "",
+		"Path to a client.authentication.k8s.io/v1 ExecCredential plugin binary (e.g. aws-iam-authenticator, "+
+			"gke-gcloud-auth-plugin). Only used when k8sresolver_auth_mode = exec.")
+	fExecArgs = FlagSet.StringSlice("k8sresolver_exec_args", nil,
+		"Comma separated arguments passed to k8sresolver_exec_command.")
+
+	fWatchTransport = FlagSet.String("k8sresolver_watch_transport", string(httpWatchTransport),
+		"Transport used to watch Endpoints changes from Kube API server. One of: http, websocket. Use "+
+			"websocket when a proxy/ingress in front of the apiserver buffers or times out chunked HTTP responses.")
 )
 
 // NewFromFlags creates resolver from flag from k8sresolver.FlagSet.
@@ -73,18 +86,41 @@ func NewFromFlags() (*resolver, error) {
 		}
 	}
 
+	mode, err := parseAuthMode(*fAuthMode)
+	if err != nil {
+		return nil, err
+	}
+
 	var source tokenauth.Source
 
-	// Try kubeconfig auth first.
-	if user := *fKubeConfigAuthUser; user != "" {
-		source, err = k8sauth.New("kube_api", *fKubeConfigAuthPath, user)
-		if err != nil {
-			return nil, errors.Wrap(err, "k8sresolver: failed to create k8sauth Source")
+	if mode == authModeAuto || mode == authModeKubeConfig {
+		if user := *fKubeConfigAuthUser; user != "" {
+			source, err = k8sauth.New("kube_api", *fKubeConfigAuthPath, user)
+			if err != nil {
+				return nil, errors.Wrap(err, "k8sresolver: failed to create k8sauth Source")
+			}
+		} else if mode == authModeKubeConfig {
+			return nil, errors.Errorf("k8sresolver: k8sresolver_auth_mode = kubeconfig requires k8sresolver_kubeconfig_user to be set")
 		}
 	}
 
+	if source == nil && (mode == authModeAuto || mode == authModeInCluster) {
+		if _, err := os.Stat(*fTokenAuthPath); err == nil {
+			source = newInClusterTokenSource("kube_api", *fTokenAuthPath)
+		} else if mode == authModeInCluster {
+			return nil, errors.Wrapf(err, "k8sresolver: k8sresolver_auth_mode = inCluster but token file %s does not exist", *fTokenAuthPath)
+		}
+	}
+
+	if mode == authModeExec {
+		if *fExecCommand == "" {
+			return nil, errors.Errorf("k8sresolver: k8sresolver_auth_mode = exec requires k8sresolver_exec_command to be set")
+		}
+		source = newExecCredentialSource("kube_api", *fExecCommand, *fExecArgs)
+	}
+
 	if source == nil {
-		// Try token auth as fallback.
+		// Try a static token file as the final fallback.
 		token, err := ioutil.ReadFile(*fTokenAuthPath)
 		if err != nil {
 			return nil, errors.Wrapf(err, "k8sresolver: failed to parse token from %s. No auth method found", *fTokenAuthPath)
@@ -92,5 +128,10 @@ func NewFromFlags() (*resolver, error) {
 		source = directauth.New("kube_api", string(token))
 	}
 
-	return New(k8sURL, source, tlsConfig), nil
+	transport, err := parseWatchTransport(*fWatchTransport)
+	if err != nil {
+		return nil, err
+	}
+
+	return New(k8sURL, source, tlsConfig, transport), nil
 }
@@ -10,14 +10,67 @@ import (
 
 	"github.com/jpillora/backoff"
 	"github.com/pkg/errors"
+	grpcresolver "google.golang.org/grpc/resolver"
 )
 
+// logger is a minimal logr.Logger-compatible interface, so callers can route streamWatcher's
+// diagnostic output into whatever logging stack they already use.
+type logger interface {
+	Info(msg string, keysAndValues ...interface{})
+	Error(err error, msg string, keysAndValues ...interface{})
+}
+
+// stdLogger is the default logger used when streamWatcherOptions.Logger is nil; it preserves the
+// previous fmt.Println based behaviour.
+type stdLogger struct{}
+
+func (stdLogger) Info(msg string, keysAndValues ...interface{}) {
+	fmt.Println(append([]interface{}{msg}, keysAndValues...)...)
+}
+
+func (stdLogger) Error(err error, msg string, keysAndValues ...interface{}) {
+	fmt.Println(append([]interface{}{errors.Wrap(err, msg)}, keysAndValues...)...)
+}
+
+// apiserverError carries the HTTP status and response body of a failed apiserver request, when the
+// transport was able to capture them, so a terminal watchResult carries enough detail to debug with.
+type apiserverError struct {
+	StatusCode int
+	Body       string
+	Err        error
+}
+
+func (e *apiserverError) Error() string {
+	if e.StatusCode == 0 {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("apiserver request failed with status %d: %s: %s", e.StatusCode, e.Body, e.Err)
+}
+
+// streamWatcherOptions holds the optional failure-handling and logging knobs for
+// startWatchingEndpointsChanges.
+type streamWatcherOptions struct {
+	// MaxConsecutiveConnectFailures is the number of consecutive StartChangeStream failures tolerated
+	// before watch gives up and pushes a terminal watchResult downstream instead of retrying forever.
+	// Zero means retry forever.
+	MaxConsecutiveConnectFailures uint
+	// MaxBackoff caps the delay between retries regardless of retryBackoff's own growth. Zero means no cap.
+	MaxBackoff time.Duration
+	// Logger receives diagnostic output for stream retries and failures. Defaults to stdLogger{}.
+	Logger logger
+}
+
 type streamWatcher struct {
 	target                  targetEntry
 	epClient                endpointClient
 	eventsCh                chan<- watchResult
 	retryBackoff            *backoff.Backoff
 	lastSeenResourceVersion int
+
+	opts streamWatcherOptions
+
+	consecutiveConnectFailures uint
+	differ                     *endpointsDiffer
 }
 
 func startWatchingEndpointsChanges(
@@ -27,13 +80,19 @@ func startWatchingEndpointsChanges(
 	eventsCh chan<- watchResult,
 	retryBackoff *backoff.Backoff,
 	lastSeenResourceVersion int,
+	opts streamWatcherOptions,
 ) *streamWatcher {
+	if opts.Logger == nil {
+		opts.Logger = stdLogger{}
+	}
 	w := &streamWatcher{
 		target:                  target,
 		epClient:                epClient,
 		eventsCh:                eventsCh,
 		retryBackoff:            retryBackoff,
 		lastSeenResourceVersion: lastSeenResourceVersion,
+		opts:                    opts,
+		differ:                  newEndpointsDiffer(),
 	}
 	go w.watch(ctx)
 	return w
@@ -46,56 +105,147 @@ const (
 	modified eventType = "MODIFIED"
 	deleted  eventType = "DELETED"
 	failed   eventType = "ERROR"
+	// bookmark events carry no object changes, only an updated resourceVersion for the watch to resume
+	// from; they must never be forwarded to eventsCh.
+	bookmark eventType = "BOOKMARK"
 )
 
+// goneStatusCode is the Kubernetes Status.code returned on a watch ERROR event once the requested
+// resourceVersion has aged out of the apiserver/etcd watch cache (HTTP 410 Gone).
+const goneStatusCode = 410
+
 // event represents a single event to a watched resource.
 type event struct {
 	Type   eventType `json:"type"`
 	Object endpoints `json:"object"`
 }
 
+// watchEnvelope is the raw shape of a single watch stream line, decoded before we know whether it
+// carries an Endpoints object (ADDED/MODIFIED/DELETED/BOOKMARK) or a Status object (ERROR).
+type watchEnvelope struct {
+	Type   eventType       `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+// watchErrorStatus is the subset of the Kubernetes Status object we care about on a watch ERROR event.
+type watchErrorStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// backoffDuration returns the next retry delay, capped at opts.MaxBackoff when one is configured.
+func (w *streamWatcher) backoffDuration() time.Duration {
+	d := w.retryBackoff.Duration()
+	if w.opts.MaxBackoff > 0 && d > w.opts.MaxBackoff {
+		return w.opts.MaxBackoff
+	}
+	return d
+}
+
+// giveUp pushes a terminal watchResult downstream once MaxConsecutiveConnectFailures has been
+// exceeded, so a caller blocked in gRPC Next() gets a diagnostic instead of hanging forever. When the
+// underlying failure was an *apiserverError, its HTTP status and response body are surfaced alongside
+// the wrapped error so the diagnostic is actionable.
+func (w *streamWatcher) giveUp(ctx context.Context, err error) {
+	keysAndValues := []interface{}{"target", w.target, "consecutiveFailures", w.consecutiveConnectFailures}
+	if apiErr, ok := errors.Cause(err).(*apiserverError); ok {
+		keysAndValues = append(keysAndValues, "statusCode", apiErr.StatusCode, "body", apiErr.Body)
+	}
+	w.opts.Logger.Error(err, "k8sresolver stream: Giving up after too many consecutive connect failures", keysAndValues...)
+
+	select {
+	case w.eventsCh <- watchResult{err: err, terminal: true}:
+	case <-ctx.Done():
+	}
+}
+
 // watch starts a stream and reads connection for every change event. If connection is broken (and ctx is still valid)
 // it retries the stream. We read connection from separate go routine because read is blocking with no timeout/cancel logic.
 // TODO(bplotka): Ugly method, refactor.
 func (w *streamWatcher) watch(ctx context.Context) {
 	// Retry stream loop.
 	for ctx.Err() == nil {
-		stream, err := w.epClient.StartChangeStream(ctx, w.target, w.lastSeenResourceVersion)
+		stream, err := w.epClient.StartChangeStream(ctx, w.target, w.lastSeenResourceVersion, true)
 		if err != nil {
-			fmt.Println(errors.Wrap(err, "k8sresolver stream: Failed to do start stream"))
-			time.Sleep(w.retryBackoff.Duration())
+			w.consecutiveConnectFailures++
+			wrapped := errors.Wrap(err, "k8sresolver stream: Failed to do start stream")
+			if w.opts.MaxConsecutiveConnectFailures > 0 && w.consecutiveConnectFailures > w.opts.MaxConsecutiveConnectFailures {
+				w.giveUp(ctx, wrapped)
+				return
+			}
 
-			// TODO(bplotka): On X retry on failed, consider returning failed to Next() via watchResult that we
-			// cannot connect.
+			w.opts.Logger.Error(wrapped, "k8sresolver stream: Retrying", "consecutiveFailures", w.consecutiveConnectFailures)
+			time.Sleep(w.backoffDuration())
 			continue
 		}
+		w.consecutiveConnectFailures = 0
 
-		err = w.proxyEvents(ctx, stream)
+		gone, err := w.proxyEvents(ctx, stream)
 		if ctx.Err() != nil {
 			return
 		}
 
+		if gone {
+			if err := w.resync(ctx); err != nil {
+				w.opts.Logger.Error(err, "k8sresolver stream: Failed to resync via LIST after 410 Gone")
+				time.Sleep(w.backoffDuration())
+			}
+			continue
+		}
+
 		if err != nil {
-			fmt.Println(errors.Wrap(err, "k8sresolver stream: Error on read and proxy Events. Retrying"))
+			w.opts.Logger.Error(err, "k8sresolver stream: Error on read and proxy Events. Retrying")
 		}
 	}
 }
 
+// resync does a full LIST of the target's Endpoints, emits it downstream as a synthetic ADDED snapshot
+// and resumes the watch from the resourceVersion the LIST was served at. It is used whenever the stream
+// reports the previously known resourceVersion is expired (HTTP 410 Gone), mirroring how client-go
+// reflectors stay correct across etcd compactions.
+func (w *streamWatcher) resync(ctx context.Context) error {
+	eps, resourceVersion, err := w.epClient.ListEndpoints(ctx, w.target)
+	if err != nil {
+		return errors.Wrap(err, "k8sresolver stream: Failed to LIST endpoints")
+	}
+
+	rv, err := strconv.Atoi(resourceVersion)
+	if err != nil {
+		return errors.Wrapf(err, "k8sresolver stream: Failed to parse LIST resourceVersion %q", resourceVersion)
+	}
+	w.lastSeenResourceVersion = rv
+
+	// Diff against the previously known state rather than forcing a full churn of the address set:
+	// a resync after a 410 Gone is not necessarily a change to the Endpoints, just a rewound watch.
+	addedAddrs, removedAddrs := w.differ.diff(eps)
+	w.eventsCh <- watchResult{
+		ep:      &event{Type: added, Object: eps},
+		Added:   addedAddrs,
+		Removed: removedAddrs,
+	}
+	return nil
+}
+
 // proxyEvents is blocking method that gets events in loop and on success proxies to eventsCh.
-// It ends only when context is cancelled and/or stream is broken.
-func (w *streamWatcher) proxyEvents(ctx context.Context, stream io.ReadCloser) error {
+// It ends only when context is cancelled, the stream is broken, or the apiserver reports the
+// resourceVersion is gone (in which case gone is true and the caller should resync via LIST).
+func (w *streamWatcher) proxyEvents(ctx context.Context, stream io.ReadCloser) (gone bool, err error) {
 	defer stream.Close()
 
 	decoder := json.NewDecoder(stream)
-	connectionErrCh := make(chan error)
+	type decodeResult struct {
+		gone bool
+		err  error
+	}
+	connectionErrCh := make(chan decodeResult)
 	go func() {
 		defer close(connectionErrCh)
 
 		for {
-			var got event
+			var raw watchEnvelope
 
 			// Blocking read.
-			if err := decoder.Decode(&got); err != nil {
+			if err := decoder.Decode(&raw); err != nil {
 				if ctx.Err() != nil {
 					// Stopping state.
 					return
@@ -103,26 +253,55 @@ func (w *streamWatcher) proxyEvents(ctx context.Context, stream io.ReadCloser) e
 				switch err {
 				case io.EOF:
 					// Watch closed normally - weird.
-					connectionErrCh <- errors.Wrap(err, "EOF during watch stream event decoding")
+					connectionErrCh <- decodeResult{err: errors.Wrap(err, "EOF during watch stream event decoding")}
 					return
 				case io.ErrUnexpectedEOF:
-					connectionErrCh <- errors.Wrap(err, "Unexpected EOF during watch stream event decoding")
+					connectionErrCh <- decodeResult{err: errors.Wrap(err, "Unexpected EOF during watch stream event decoding")}
 					return
 				default:
 
 				}
 				// This is odd case. We return error as well as recreate stream.
 				err := errors.Wrap(err, "Unable to decode an event from the watch stream")
-				connectionErrCh <- err
+				connectionErrCh <- decodeResult{err: err}
 				w.eventsCh <- watchResult{
 					err: errors.Wrap(err, "Unable to decode an event from the watch stream"),
 				}
 				return
 			}
 
-			switch got.Type {
-			case added, modified, deleted, failed:
-				rv, err := strconv.Atoi(got.Object.Metadata.ResourceVersion)
+			switch raw.Type {
+			case failed:
+				var status watchErrorStatus
+				if err := json.Unmarshal(raw.Object, &status); err == nil && status.Code == goneStatusCode {
+					connectionErrCh <- decodeResult{gone: true}
+					return
+				}
+				w.eventsCh <- watchResult{
+					err: errors.Errorf("Got watch ERROR event: %s", string(raw.Object)),
+				}
+			case bookmark:
+				var obj endpoints
+				if err := json.Unmarshal(raw.Object, &obj); err != nil {
+					w.eventsCh <- watchResult{err: err}
+					continue
+				}
+				rv, err := strconv.Atoi(obj.Metadata.ResourceVersion)
+				if err != nil {
+					w.eventsCh <- watchResult{err: err}
+					continue
+				}
+				// Bookmarks only move the watermark forward; they must not be forwarded to eventsCh.
+				w.lastSeenResourceVersion = rv
+			case added, modified, deleted:
+				var obj endpoints
+				if err := json.Unmarshal(raw.Object, &obj); err != nil {
+					w.eventsCh <- watchResult{err: err}
+					continue
+				}
+				got := event{Type: raw.Type, Object: obj}
+
+				rv, err := strconv.Atoi(obj.Metadata.ResourceVersion)
 				if err != nil {
 					w.eventsCh <- watchResult{
 						ep:  &got,
@@ -131,12 +310,21 @@ func (w *streamWatcher) proxyEvents(ctx context.Context, stream io.ReadCloser) e
 					continue
 				}
 				w.lastSeenResourceVersion = rv
+
+				var addedAddrs, removedAddrs []grpcresolver.Address
+				if raw.Type == deleted {
+					removedAddrs = w.differ.diffRemoveAll()
+				} else {
+					addedAddrs, removedAddrs = w.differ.diff(obj)
+				}
 				w.eventsCh <- watchResult{
-					ep: &got,
+					ep:      &got,
+					Added:   addedAddrs,
+					Removed: removedAddrs,
 				}
 			default:
 				w.eventsCh <- watchResult{
-					err: errors.Errorf("Got invalid watch event type: %v", got.Type),
+					err: errors.Errorf("Got invalid watch event type: %v", raw.Type),
 				}
 			}
 		}
@@ -147,8 +335,8 @@ func (w *streamWatcher) proxyEvents(ctx context.Context, stream io.ReadCloser) e
 	select {
 	case <-ctx.Done():
 		// Stopping state.
-		return ctx.Err()
-	case err := <-connectionErrCh:
-		return err
+		return false, ctx.Err()
+	case res := <-connectionErrCh:
+		return res.gone, res.err
 	}
 }
@@ -11,6 +11,7 @@ import (
 	"github.com/jpillora/backoff"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
+	grpcresolver "google.golang.org/grpc/resolver"
 )
 
 type readerCloserMock struct {
@@ -41,12 +42,20 @@ type endpointClientMock struct {
 	expectedResourceVersion int
 
 	connMock   *readerCloserMock
+	connectErr error
 	reconnects uint
+	listResult endpoints
+	listRV     string
+	listCalls  uint
 }
 
-func (m *endpointClientMock) StartChangeStream(ctx context.Context, t targetEntry, resourceVersion int) (io.ReadCloser, error) {
+func (m *endpointClientMock) StartChangeStream(ctx context.Context, t targetEntry, resourceVersion int, allowBookmarks bool) (io.ReadCloser, error) {
 	m.reconnects++
 	require.Equal(m.t, m.expectedTarget, t)
+	require.True(m.t, allowBookmarks, "streamWatcher should always request bookmarks")
+	if m.connectErr != nil {
+		return nil, m.connectErr
+	}
 	return m.connMock, nil
 }
 
@@ -54,6 +63,12 @@ func (m *endpointClientMock) StartSingleUnary(ctx context.Context, t targetEntry
 	return nil, errors.New("Not implemented")
 }
 
+func (m *endpointClientMock) ListEndpoints(ctx context.Context, t targetEntry) (endpoints, string, error) {
+	m.listCalls++
+	require.Equal(m.t, m.expectedTarget, t)
+	return m.listResult, m.listRV, nil
+}
+
 func TestStreamWatcher(t *testing.T) {
 	bytesCh := make(chan []byte)
 	ctx, cancel := context.WithCancel(context.TODO())
@@ -88,6 +103,7 @@ func TestStreamWatcher(t *testing.T) {
 		eventsCh,
 		&backoff.Backoff{Min: 10 * time.Millisecond, Max: 10 * time.Millisecond},
 		0,
+		streamWatcherOptions{},
 	)
 
 	localReconnectCounter := uint(1)
@@ -143,6 +159,235 @@ func TestStreamWatcher(t *testing.T) {
 	eventCh = <-eventsCh
 	require.NoError(t, eventCh.err)
 	require.Equal(t, expectedEvent, *eventCh.ep)
+	require.Equal(t, []grpcresolver.Address{{Addr: "1.2.3.4:8080"}}, eventCh.Added)
+	require.Empty(t, eventCh.Removed)
 
 	require.Equal(t, localReconnectCounter, epClientMock.reconnects)
+
+	// A BOOKMARK should move the watermark forward but never reach eventsCh.
+	bookmarkEvent := event{
+		Type: bookmark,
+		Object: endpoints{
+			Metadata: metadata{
+				ResourceVersion: "124",
+			},
+		},
+	}
+	b, err = json.Marshal(bookmarkEvent)
+	require.NoError(t, err)
+	bytesCh <- b
+
+	select {
+	case res := <-eventsCh:
+		t.Fatalf("did not expect a BOOKMARK to be forwarded to eventsCh, got %+v", res)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestStreamWatcher_DiffOnModifiedAndDeleted(t *testing.T) {
+	bytesCh := make(chan []byte)
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	connMock := &readerCloserMock{
+		Ctx:     ctx,
+		BytesCh: bytesCh,
+	}
+
+	testTarget := targetEntry{
+		service:   "service1",
+		port:      noTargetPort,
+		namespace: "namespace1",
+	}
+
+	epClientMock := &endpointClientMock{
+		t:              t,
+		expectedTarget: testTarget,
+		connMock:       connMock,
+	}
+
+	streamWatcherCtx, cancel2 := context.WithCancel(ctx)
+	defer cancel2()
+
+	eventsCh := make(chan watchResult)
+
+	startWatchingEndpointsChanges(
+		streamWatcherCtx,
+		testTarget,
+		epClientMock,
+		eventsCh,
+		&backoff.Backoff{Min: 10 * time.Millisecond, Max: 10 * time.Millisecond},
+		0,
+		streamWatcherOptions{},
+	)
+
+	addedEvent := event{
+		Type: added,
+		Object: endpoints{
+			Metadata: metadata{ResourceVersion: "1"},
+			Subsets: []subset{
+				{
+					Ports:     []port{{Port: 8080, Name: "noName"}},
+					Addresses: []address{{IP: "1.2.3.4"}},
+				},
+			},
+		},
+	}
+	b, err := json.Marshal(addedEvent)
+	require.NoError(t, err)
+	bytesCh <- b
+	eventCh := <-eventsCh
+	require.NoError(t, eventCh.err)
+	require.Equal(t, []grpcresolver.Address{{Addr: "1.2.3.4:8080"}}, eventCh.Added)
+	require.Empty(t, eventCh.Removed)
+
+	// MODIFIED drops 1.2.3.4 and adds 5.6.7.8: Added/Removed should reflect just that delta.
+	modifiedEvent := event{
+		Type: modified,
+		Object: endpoints{
+			Metadata: metadata{ResourceVersion: "2"},
+			Subsets: []subset{
+				{
+					Ports:     []port{{Port: 8080, Name: "noName"}},
+					Addresses: []address{{IP: "5.6.7.8"}},
+				},
+			},
+		},
+	}
+	b, err = json.Marshal(modifiedEvent)
+	require.NoError(t, err)
+	bytesCh <- b
+	eventCh = <-eventsCh
+	require.NoError(t, eventCh.err)
+	require.Equal(t, []grpcresolver.Address{{Addr: "5.6.7.8:8080"}}, eventCh.Added)
+	require.Equal(t, []grpcresolver.Address{{Addr: "1.2.3.4:8080"}}, eventCh.Removed)
+
+	// DELETED should produce a full-removal diff of whatever is still tracked (5.6.7.8), regardless
+	// of what the deleted object itself carries.
+	deletedEvent := event{
+		Type:   deleted,
+		Object: endpoints{Metadata: metadata{ResourceVersion: "3"}},
+	}
+	b, err = json.Marshal(deletedEvent)
+	require.NoError(t, err)
+	bytesCh <- b
+	eventCh = <-eventsCh
+	require.NoError(t, eventCh.err)
+	require.Empty(t, eventCh.Added)
+	require.Equal(t, []grpcresolver.Address{{Addr: "5.6.7.8:8080"}}, eventCh.Removed)
+}
+
+func TestStreamWatcher_ResyncOn410Gone(t *testing.T) {
+	bytesCh := make(chan []byte)
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	connMock := &readerCloserMock{
+		Ctx:     ctx,
+		BytesCh: bytesCh,
+	}
+
+	testTarget := targetEntry{
+		service:   "service1",
+		port:      noTargetPort,
+		namespace: "namespace1",
+	}
+
+	listedEndpoints := endpoints{
+		Metadata: metadata{
+			ResourceVersion: "200",
+		},
+		Subsets: []subset{
+			{
+				Ports: []port{
+					{Port: 0, Name: "noName"},
+				},
+				Addresses: []address{
+					{IP: "5.6.7.8"},
+				},
+			},
+		},
+	}
+
+	epClientMock := &endpointClientMock{
+		t:              t,
+		expectedTarget: testTarget,
+		connMock:       connMock,
+		listResult:     listedEndpoints,
+		listRV:         "200",
+	}
+
+	streamWatcherCtx, cancel2 := context.WithCancel(ctx)
+	defer cancel2()
+
+	eventsCh := make(chan watchResult)
+
+	startWatchingEndpointsChanges(
+		streamWatcherCtx,
+		testTarget,
+		epClientMock,
+		eventsCh,
+		&backoff.Backoff{Min: 10 * time.Millisecond, Max: 10 * time.Millisecond},
+		0,
+		streamWatcherOptions{},
+	)
+
+	goneEvent := event{Type: failed}
+	b, err := json.Marshal(struct {
+		Type   eventType        `json:"type"`
+		Object watchErrorStatus `json:"object"`
+	}{
+		Type:   goneEvent.Type,
+		Object: watchErrorStatus{Code: goneStatusCode, Message: "too old resource version"},
+	})
+	require.NoError(t, err)
+	bytesCh <- b
+
+	eventCh := <-eventsCh
+	require.NoError(t, eventCh.err)
+	require.Equal(t, &event{Type: added, Object: listedEndpoints}, eventCh.ep)
+	require.Equal(t, []grpcresolver.Address{{Addr: "5.6.7.8:0"}}, eventCh.Added)
+	require.Equal(t, uint(1), epClientMock.listCalls, "expected a single LIST after 410 Gone")
+}
+
+func TestStreamWatcher_TerminalAfterMaxConsecutiveConnectFailures(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	testTarget := targetEntry{
+		service:   "service1",
+		port:      noTargetPort,
+		namespace: "namespace1",
+	}
+
+	epClientMock := &endpointClientMock{
+		t:              t,
+		expectedTarget: testTarget,
+		connectErr:     &apiserverError{StatusCode: 503, Body: "upstream connect error", Err: errors.New("connection refused")},
+	}
+
+	streamWatcherCtx, cancel2 := context.WithCancel(ctx)
+	defer cancel2()
+
+	eventsCh := make(chan watchResult)
+
+	startWatchingEndpointsChanges(
+		streamWatcherCtx,
+		testTarget,
+		epClientMock,
+		eventsCh,
+		&backoff.Backoff{Min: time.Millisecond, Max: time.Millisecond},
+		0,
+		streamWatcherOptions{MaxConsecutiveConnectFailures: 3},
+	)
+
+	eventCh := <-eventsCh
+	require.Error(t, eventCh.err)
+	require.True(t, eventCh.terminal, "expected a terminal watchResult once MaxConsecutiveConnectFailures is exceeded")
+	require.GreaterOrEqual(t, epClientMock.reconnects, uint(3))
+
+	apiErr, ok := errors.Cause(eventCh.err).(*apiserverError)
+	require.True(t, ok, "expected the terminal watchResult to wrap the original *apiserverError")
+	require.Equal(t, 503, apiErr.StatusCode)
+	require.Equal(t, "upstream connect error", apiErr.Body)
 }
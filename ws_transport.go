@@ -0,0 +1,101 @@
+package k8sresolver
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+)
+
+// watchTransport selects how streamWatcher reads the Endpoints watch stream from the Kube API server.
+type watchTransport string
+
+const (
+	httpWatchTransport      watchTransport = "http"
+	websocketWatchTransport watchTransport = "websocket"
+)
+
+// parseWatchTransport validates a --k8sresolver_watch_transport flag value.
+func parseWatchTransport(raw string) (watchTransport, error) {
+	switch watchTransport(raw) {
+	case httpWatchTransport, websocketWatchTransport:
+		return watchTransport(raw), nil
+	default:
+		return "", errors.Errorf("k8sresolver: unknown k8sresolver_watch_transport value %q, expected 'http' or 'websocket'", raw)
+	}
+}
+
+// websocketChannelSubProtocol is the Kubernetes watch subprotocol that multiplexes the JSON event stream
+// over base64-framed websocket messages, keyed off the same machinery used for exec/attach channels.
+const websocketChannelSubProtocol = "v4.channel.k8s.io"
+
+// dialWatchWebsocket opens a watch connection to rawURL (expected to already carry watch=1 and
+// resourceVersion query params) over the Kubernetes websocket subprotocol and returns an io.ReadCloser
+// that yields the same newline-delimited JSON an HTTP chunked watch would, so proxyEvents does not need
+// to know which transport produced it.
+func dialWatchWebsocket(ctx context.Context, rawURL string, header http.Header) (*websocketFrameReader, error) {
+	wsURL, err := toWebsocketURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &websocket.Dialer{Subprotocols: []string{websocketChannelSubProtocol}}
+	conn, _, err := dialer.DialContext(ctx, wsURL, header)
+	if err != nil {
+		return nil, errors.Wrap(err, "k8sresolver: failed to dial watch websocket")
+	}
+
+	return &websocketFrameReader{conn: conn}, nil
+}
+
+// toWebsocketURL rewrites a http(s) watch URL into its ws(s) equivalent.
+func toWebsocketURL(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", errors.Wrapf(err, "k8sresolver: invalid watch URL %s", rawURL)
+	}
+	switch u.Scheme {
+	case "https":
+		u.Scheme = "wss"
+	case "http":
+		u.Scheme = "ws"
+	}
+	return u.String(), nil
+}
+
+// websocketFrameReader adapts a *websocket.Conn carrying base64-framed watch.json messages into a plain
+// io.ReadCloser, so the rest of streamWatcher can keep decoding newline-delimited JSON exactly as it does
+// for the chunked HTTP transport.
+type websocketFrameReader struct {
+	conn *websocket.Conn
+	buf  bytes.Buffer
+}
+
+func (r *websocketFrameReader) Read(p []byte) (int, error) {
+	for r.buf.Len() == 0 {
+		_, frame, err := r.conn.ReadMessage()
+		if err != nil {
+			return 0, errors.Wrap(err, "k8sresolver: failed to read watch websocket frame")
+		}
+		// First byte is the channel index per the v4.channel.k8s.io framing; channel 0 carries event JSON.
+		if len(frame) == 0 || frame[0] != 0 {
+			continue
+		}
+		decoded := make([]byte, base64.StdEncoding.DecodedLen(len(frame)-1))
+		n, err := base64.StdEncoding.Decode(decoded, frame[1:])
+		if err != nil {
+			return 0, errors.Wrap(err, "k8sresolver: failed to base64-decode watch websocket frame")
+		}
+		r.buf.Write(decoded[:n])
+		r.buf.WriteByte('\n')
+	}
+	return r.buf.Read(p)
+}
+
+func (r *websocketFrameReader) Close() error {
+	return r.conn.Close()
+}
@@ -0,0 +1,101 @@
+package k8sresolver
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseWatchTransport(t *testing.T) {
+	for _, tc := range []struct {
+		raw     string
+		want    watchTransport
+		wantErr bool
+	}{
+		{raw: "http", want: httpWatchTransport},
+		{raw: "websocket", want: websocketWatchTransport},
+		{raw: "bogus", wantErr: true},
+		{raw: "", wantErr: true},
+	} {
+		t.Run(tc.raw, func(t *testing.T) {
+			got, err := parseWatchTransport(tc.raw)
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestToWebsocketURL(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want string
+	}{
+		{
+			in:   "http://k8s.local/api/v1/namespaces/ns/endpoints?watch=1",
+			want: "ws://k8s.local/api/v1/namespaces/ns/endpoints?watch=1",
+		},
+		{
+			in:   "https://k8s.local:6443/api/v1/namespaces/ns/endpoints?watch=1",
+			want: "wss://k8s.local:6443/api/v1/namespaces/ns/endpoints?watch=1",
+		},
+	} {
+		got, err := toWebsocketURL(tc.in)
+		require.NoError(t, err)
+		require.Equal(t, tc.want, got)
+	}
+}
+
+func TestToWebsocketURL_InvalidURL(t *testing.T) {
+	_, err := toWebsocketURL("://not-a-url")
+	require.Error(t, err)
+}
+
+func TestDialWatchWebsocket_DecodesFramesAndForwardsAuthHeader(t *testing.T) {
+	upgrader := websocket.Upgrader{Subprotocols: []string{websocketChannelSubProtocol}}
+
+	var gotHeader http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header.Clone()
+		conn, err := upgrader.Upgrade(w, r, nil)
+		require.NoError(t, err)
+		defer conn.Close()
+
+		addedPayload := base64.StdEncoding.EncodeToString([]byte(`{"type":"ADDED"}`))
+		modifiedPayload := base64.StdEncoding.EncodeToString([]byte(`{"type":"MODIFIED"}`))
+		// Channel 0 carries the event JSON and must be decoded.
+		require.NoError(t, conn.WriteMessage(websocket.BinaryMessage, append([]byte{0}, addedPayload...)))
+		// Non-zero channels (e.g. stderr on exec/attach streams) must be skipped.
+		require.NoError(t, conn.WriteMessage(websocket.BinaryMessage, append([]byte{1}, addedPayload...)))
+		require.NoError(t, conn.WriteMessage(websocket.BinaryMessage, append([]byte{0}, modifiedPayload...)))
+	}))
+	defer server.Close()
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer test-token")
+
+	reader, err := dialWatchWebsocket(context.Background(), server.URL, header)
+	require.NoError(t, err)
+	defer reader.Close()
+
+	require.Equal(t, "Bearer test-token", gotHeader.Get("Authorization"))
+
+	buf := make([]byte, 64)
+	n, err := reader.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, `{"type":"ADDED"}`+"\n", string(buf[:n]))
+
+	// The channel-1 frame in between must be skipped rather than surfaced or corrupting the stream;
+	// the next Read should jump straight to the second channel-0 frame.
+	n, err = reader.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, `{"type":"MODIFIED"}`+"\n", string(buf[:n]))
+}